@@ -0,0 +1,182 @@
+package buffer
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+)
+
+// Flusher is implemented by buffers returned from NewBuffered, letting
+// callers push pending writes out to the wrapped buffer ahead of the next
+// automatic flush.
+type Flusher interface {
+	Flush() error
+}
+
+// bufferedBuffer coalesces small Write calls and pre-fills a cache for small
+// Read calls, in the style of bufio.ReadWriter.
+type bufferedBuffer struct {
+	inner Buffer
+
+	readBuf []byte // cached bytes already pulled from inner
+	readOff int
+	readCap int
+
+	writeBuf []byte // bytes not yet pushed to inner
+	writeCap int
+}
+
+// NewBuffered wraps inner with a readBufSize-byte read-ahead cache and a
+// writeBufSize-byte write-coalescing cache, amortizing the cost of small
+// Write/Read calls against inner.
+func NewBuffered(inner Buffer, readBufSize, writeBufSize int) Buffer {
+	return &bufferedBuffer{
+		inner:    inner,
+		readCap:  readBufSize,
+		writeBuf: make([]byte, 0, writeBufSize),
+		writeCap: writeBufSize,
+	}
+}
+
+func (b *bufferedBuffer) Write(p []byte) (int, error) {
+	if b.writeCap <= 0 {
+		// Nothing to coalesce into: the loop below relies on the write cache
+		// eventually filling up to trigger a flush, which never happens at
+		// capacity zero and would otherwise spin forever.
+		return b.inner.Write(p)
+	}
+
+	var total int
+	for len(p) > 0 {
+		free := b.writeCap - len(b.writeBuf)
+		if free > 0 {
+			n := len(p)
+			if n > free {
+				n = free
+			}
+			b.writeBuf = append(b.writeBuf, p[:n]...)
+			p = p[n:]
+			total += n
+		}
+		if len(p) == 0 {
+			break
+		}
+
+		// The write cache is full but there's more data: flush it to make
+		// room. If the flush can't land all of it, bytes still stuck in the
+		// cache after the flush never made it to inner, so don't count them
+		// as written by this call even though they were briefly buffered.
+		if err := b.Flush(); err != nil {
+			if lost := len(b.writeBuf); lost > 0 {
+				if lost > total {
+					lost = total
+				}
+				total -= lost
+			}
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// Flush pushes any pending writes out to inner.
+func (b *bufferedBuffer) Flush() error {
+	if len(b.writeBuf) == 0 {
+		return nil
+	}
+	n, err := b.inner.Write(b.writeBuf)
+	b.writeBuf = b.writeBuf[:copy(b.writeBuf, b.writeBuf[n:])]
+	return err
+}
+
+func (b *bufferedBuffer) Read(p []byte) (int, error) {
+	// Bytes still sitting in writeBuf haven't reached inner yet, so a Read
+	// would otherwise miss them even though Len() counts them as present.
+	// A short flush (inner's cache is also full) still surfaces whatever
+	// did land; only a harder error needs to abort the Read outright.
+	if len(b.writeBuf) > 0 {
+		if err := b.Flush(); err != nil && err != io.ErrShortWrite {
+			return 0, err
+		}
+	}
+
+	if b.readOff < len(b.readBuf) {
+		n := copy(p, b.readBuf[b.readOff:])
+		b.readOff += n
+		return n, nil
+	}
+	if len(p) >= b.readCap {
+		return b.inner.Read(p)
+	}
+
+	if cap(b.readBuf) < b.readCap {
+		b.readBuf = make([]byte, b.readCap)
+	}
+	n, err := b.inner.Read(b.readBuf[:cap(b.readBuf)])
+	b.readBuf = b.readBuf[:n]
+	b.readOff = 0
+	if n == 0 {
+		return 0, err
+	}
+	m := copy(p, b.readBuf)
+	b.readOff = m
+	return m, nil
+}
+
+func (b *bufferedBuffer) Len() int64 {
+	// Bytes cached in readBuf already left inner, so they must be added back
+	// in, not subtracted, to report what's still unread by the consumer.
+	return b.inner.Len() + int64(len(b.writeBuf)) + int64(len(b.readBuf)-b.readOff)
+}
+
+func (b *bufferedBuffer) Cap() int64 {
+	return b.inner.Cap()
+}
+
+func (b *bufferedBuffer) Reset() {
+	b.inner.Reset()
+	b.readBuf = b.readBuf[:0]
+	b.readOff = 0
+	b.writeBuf = b.writeBuf[:0]
+}
+
+type gobBuffered struct {
+	Inner    Buffer
+	ReadBuf  []byte
+	ReadOff  int
+	ReadCap  int
+	WriteCap int
+}
+
+func (b *bufferedBuffer) GobEncode() ([]byte, error) {
+	if err := b.Flush(); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buf).Encode(gobBuffered{
+		Inner:    b.inner,
+		ReadBuf:  b.readBuf,
+		ReadOff:  b.readOff,
+		ReadCap:  b.readCap,
+		WriteCap: b.writeCap,
+	})
+	return buf.Bytes(), err
+}
+
+func (b *bufferedBuffer) GobDecode(data []byte) error {
+	var g gobBuffered
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&g); err != nil {
+		return err
+	}
+	b.inner = g.Inner
+	b.readBuf = g.ReadBuf
+	b.readOff = g.ReadOff
+	b.readCap = g.ReadCap
+	b.writeCap = g.WriteCap
+	b.writeBuf = make([]byte, 0, g.WriteCap)
+	return nil
+}
+
+func init() {
+	gob.Register(&bufferedBuffer{})
+}
@@ -0,0 +1,121 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestBufferedRoundTrip(t *testing.T) {
+	buf := NewBuffered(New(1024), 64, 64)
+	data := []byte("hello buffered world")
+	for _, c := range data {
+		if _, err := buf.Write([]byte{c}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := buf.(Flusher).Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]byte, 0, len(data))
+	one := make([]byte, 1)
+	for len(got) < len(data) {
+		n, err := buf.Read(one)
+		got = append(got, one[:n]...)
+		if err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %q, want %q", got, data)
+	}
+}
+
+func TestBufferedReadFlushesPendingWrite(t *testing.T) {
+	buf := NewBuffered(New(1024), 64, 64)
+	if _, err := buf.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]byte, 5)
+	n, err := buf.Read(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || string(got) != "hello" {
+		t.Errorf("expected Read to see the still-pending write, got n=%d data=%q", n, got[:n])
+	}
+}
+
+func TestBufferedLen(t *testing.T) {
+	buf := NewBuffered(New(1024), 64, 64)
+	buf.Write([]byte("hello"))
+	if buf.Len() != 5 {
+		t.Errorf("expected pending write to be reflected in Len(), got %d", buf.Len())
+	}
+	buf.(Flusher).Flush()
+	if buf.Len() != 5 {
+		t.Errorf("expected Len() to be unchanged across a flush, got %d", buf.Len())
+	}
+
+	// Reading pulls bytes out of inner into the read cache; until the
+	// consumer actually takes them, they must still count towards Len().
+	buf.Read(make([]byte, 1))
+	if buf.Len() != 4 {
+		t.Errorf("expected Len() to only drop by what the consumer actually read, got %d", buf.Len())
+	}
+}
+
+func TestBufferedReset(t *testing.T) {
+	buf := NewBuffered(New(1024), 64, 64)
+	buf.Write([]byte("hello"))
+	buf.Reset()
+	if buf.Len() != 0 {
+		t.Errorf("expected reset buffer to be empty, got len %d", buf.Len())
+	}
+}
+
+func TestBufferedZeroWriteCap(t *testing.T) {
+	buf := NewBuffered(New(1024), 64, 0)
+	done := make(chan struct{})
+	go func() {
+		buf.Write([]byte("hello"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Write hung with writeBufSize == 0")
+	}
+	if buf.Len() != 5 {
+		t.Errorf("expected write-through to inner, got len %d", buf.Len())
+	}
+}
+
+func BenchmarkBufferedSmallWrites(b *testing.B) {
+	data := make([]byte, 32*1024)
+	for i := 0; i < b.N; i++ {
+		buf := NewBuffered(New(32*1024), 4096, 4096)
+		for _, c := range data {
+			buf.Write([]byte{c})
+		}
+		buf.(Flusher).Flush()
+		io.Copy(ioutil.Discard, buf)
+	}
+}
+
+func BenchmarkBufferedSmallReads(b *testing.B) {
+	data := make([]byte, 32*1024)
+	for i := 0; i < b.N; i++ {
+		buf := NewBuffered(New(32*1024), 4096, 4096)
+		buf.Write(data)
+		buf.(Flusher).Flush()
+		one := make([]byte, 1)
+		for buf.Len() > 0 {
+			buf.Read(one)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package buffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/s2"
+)
+
+// compressedFrameSize is the amount of uncompressed data packed into each
+// frame written to the inner buffer.
+const compressedFrameSize = 64 * 1024
+
+// frameHeaderSize is the size, in bytes, of the header written before each
+// compressed frame: a big-endian uint32 uncompressed length followed by a
+// big-endian uint32 compressed length.
+const frameHeaderSize = 8
+
+// Codec compresses and decompresses independent frames of data.
+type Codec interface {
+	MaxEncodedLen(n int) int
+	Encode(dst, src []byte) []byte
+	Decode(dst, src []byte) ([]byte, error)
+}
+
+type snappyCodec struct{}
+
+// SnappyCodec compresses frames using the Snappy block format.
+var SnappyCodec Codec = snappyCodec{}
+
+func (snappyCodec) MaxEncodedLen(n int) int { return snappy.MaxEncodedLen(n) }
+
+func (snappyCodec) Encode(dst, src []byte) []byte { return snappy.Encode(dst, src) }
+
+func (snappyCodec) Decode(dst, src []byte) ([]byte, error) { return snappy.Decode(dst, src) }
+
+type s2Codec struct{}
+
+// S2Codec compresses frames using the S2 block format, a faster variant of
+// Snappy.
+var S2Codec Codec = s2Codec{}
+
+func (s2Codec) MaxEncodedLen(n int) int { return s2.MaxEncodedLen(n) }
+
+func (s2Codec) Encode(dst, src []byte) []byte { return s2.Encode(dst, src) }
+
+func (s2Codec) Decode(dst, src []byte) ([]byte, error) { return s2.Decode(dst, src) }
+
+// compressedBuffer wraps an inner Buffer, storing Write()n data as a stream
+// of independently-decodable compressed frames.
+type compressedBuffer struct {
+	inner Buffer
+	codec Codec
+
+	raw      []byte // undecoded frame bytes read from inner but not yet assembled
+	frame    []byte // the single in-flight decoded frame
+	frameOff int
+
+	encBuf []byte // scratch space reused across Write calls
+}
+
+// NewCompressed wraps inner so that everything written to it is compressed
+// with codec before being stored, and transparently decompressed on Read.
+func NewCompressed(inner Buffer, codec Codec) Buffer {
+	return &compressedBuffer{inner: inner, codec: codec}
+}
+
+func (c *compressedBuffer) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > compressedFrameSize {
+			chunk = chunk[:compressedFrameSize]
+		}
+
+		maxLen := c.codec.MaxEncodedLen(len(chunk))
+		if cap(c.encBuf) < maxLen {
+			c.encBuf = make([]byte, maxLen)
+		}
+		compressed := c.codec.Encode(c.encBuf[:maxLen], chunk)
+
+		// Only ever emit a complete frame: check there's room for the whole
+		// thing before writing any of it to the inner buffer.
+		frameLen := int64(frameHeaderSize + len(compressed))
+		if frameLen > c.inner.Cap()-c.inner.Len() {
+			return written, io.ErrShortWrite
+		}
+
+		var hdr [frameHeaderSize]byte
+		binary.BigEndian.PutUint32(hdr[0:4], uint32(len(chunk)))
+		binary.BigEndian.PutUint32(hdr[4:8], uint32(len(compressed)))
+
+		if _, err := c.inner.Write(hdr[:]); err != nil {
+			return written, err
+		}
+		if _, err := c.inner.Write(compressed); err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+func (c *compressedBuffer) Read(p []byte) (int, error) {
+	if c.frameOff < len(c.frame) {
+		n := copy(p, c.frame[c.frameOff:])
+		c.frameOff += n
+		return n, nil
+	}
+
+	fill := make([]byte, 4096)
+	for {
+		frame, ok, err := c.decodeNextFrame()
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			m := copy(p, frame)
+			c.frame = frame
+			c.frameOff = m
+			return m, nil
+		}
+
+		n, err := c.inner.Read(fill)
+		if n > 0 {
+			c.raw = append(c.raw, fill[:n]...)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+}
+
+// decodeNextFrame decodes a full frame out of c.raw, if one has accumulated.
+// A codec error is returned rather than swallowed, since skipping the frame
+// would silently truncate the stream.
+func (c *compressedBuffer) decodeNextFrame() ([]byte, bool, error) {
+	if len(c.raw) < frameHeaderSize {
+		return nil, false, nil
+	}
+	uncompLen := binary.BigEndian.Uint32(c.raw[0:4])
+	compLen := binary.BigEndian.Uint32(c.raw[4:8])
+	need := frameHeaderSize + int(compLen)
+	if len(c.raw) < need {
+		return nil, false, nil
+	}
+	decoded, err := c.codec.Decode(make([]byte, uncompLen), c.raw[frameHeaderSize:need])
+	if err != nil {
+		return nil, false, err
+	}
+	c.raw = c.raw[need:]
+	return decoded, true, nil
+}
+
+func (c *compressedBuffer) Len() int64 { return c.inner.Len() }
+
+func (c *compressedBuffer) Cap() int64 { return c.inner.Cap() }
+
+func (c *compressedBuffer) Reset() {
+	c.inner.Reset()
+	c.raw = nil
+	c.frame = nil
+	c.frameOff = 0
+}
+
+const (
+	codecTagSnappy byte = 1
+	codecTagS2     byte = 2
+)
+
+func codecTag(c Codec) (byte, bool) {
+	switch c.(type) {
+	case snappyCodec:
+		return codecTagSnappy, true
+	case s2Codec:
+		return codecTagS2, true
+	}
+	return 0, false
+}
+
+func codecFromTag(tag byte) (Codec, bool) {
+	switch tag {
+	case codecTagSnappy:
+		return SnappyCodec, true
+	case codecTagS2:
+		return S2Codec, true
+	}
+	return nil, false
+}
+
+type gobCompressed struct {
+	Inner    Buffer
+	CodecTag byte
+	Raw      []byte
+	Frame    []byte
+	FrameOff int
+}
+
+func (c *compressedBuffer) GobEncode() ([]byte, error) {
+	tag, ok := codecTag(c.codec)
+	if !ok {
+		return nil, fmt.Errorf("buffer: cannot gob-encode compressed buffer with unregistered codec")
+	}
+	buf := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buf).Encode(gobCompressed{
+		Inner:    c.inner,
+		CodecTag: tag,
+		Raw:      c.raw,
+		Frame:    c.frame,
+		FrameOff: c.frameOff,
+	})
+	return buf.Bytes(), err
+}
+
+func (c *compressedBuffer) GobDecode(data []byte) error {
+	var g gobCompressed
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&g); err != nil {
+		return err
+	}
+	codec, ok := codecFromTag(g.CodecTag)
+	if !ok {
+		return fmt.Errorf("buffer: unknown compressed buffer codec tag %d", g.CodecTag)
+	}
+	c.inner = g.Inner
+	c.codec = codec
+	c.raw = g.Raw
+	c.frame = g.Frame
+	c.frameOff = g.FrameOff
+	return nil
+}
+
+func init() {
+	gob.Register(&compressedBuffer{})
+}
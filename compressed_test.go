@@ -0,0 +1,79 @@
+package buffer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCompressedRoundTrip(t *testing.T) {
+	codecs := map[string]Codec{"snappy": SnappyCodec, "s2": S2Codec}
+	cases := map[string][]byte{
+		"random":       randomBytes(t, 150*1024),
+		"compressible": bytes.Repeat([]byte("a"), 150*1024),
+		"exact-frame":  randomBytes(t, compressedFrameSize),
+	}
+
+	for name, codec := range codecs {
+		for caseName, data := range cases {
+			buf := NewCompressed(New(4*1024*1024), codec)
+			if _, err := buf.Write(data); err != nil {
+				t.Fatalf("%s/%s: write failed: %s", name, caseName, err)
+			}
+
+			got, err := ioutil.ReadAll(buf)
+			if err != nil {
+				t.Fatalf("%s/%s: read failed: %s", name, caseName, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%s/%s: round trip mismatch", name, caseName)
+			}
+		}
+	}
+}
+
+func TestCompressedShortWrite(t *testing.T) {
+	buf := NewCompressed(New(10), SnappyCodec)
+	n, err := buf.Write(bytes.Repeat([]byte("x"), 150*1024))
+	if err != io.ErrShortWrite {
+		t.Errorf("expected io.ErrShortWrite, got %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expected no bytes absorbed when even the first frame can't fit, got %d", n)
+	}
+}
+
+func TestCompressedCorruptFrame(t *testing.T) {
+	inner := New(1024)
+	var hdr [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(hdr[0:4], 5)
+	binary.BigEndian.PutUint32(hdr[4:8], 5)
+	inner.Write(hdr[:])
+	inner.Write([]byte{0xff, 0xff, 0xff, 0xff, 0xff})
+
+	buf := NewCompressed(inner, SnappyCodec)
+	if _, err := buf.Read(make([]byte, 5)); err == nil || err == io.EOF {
+		t.Errorf("expected a decode error for a corrupt frame, got %v", err)
+	}
+}
+
+func TestCompressedReset(t *testing.T) {
+	buf := NewCompressed(New(1024), SnappyCodec)
+	buf.Write([]byte("hello world"))
+	buf.Read(make([]byte, 3))
+	buf.Reset()
+	if buf.Len() != 0 {
+		t.Errorf("expected reset buffer to be empty, got len %d", buf.Len())
+	}
+}
@@ -0,0 +1,171 @@
+package buffer
+
+import (
+	"io"
+	"sync"
+)
+
+// ConcurrencyMode selects how a buffer returned from NewConcurrent behaves
+// when the wrapped buffer is full on Write or empty on Read.
+type ConcurrencyMode int
+
+const (
+	// NonBlocking guards the inner buffer with a mutex and otherwise behaves
+	// exactly as the wrapped buffer already does: io.ErrShortWrite on a full
+	// Write, io.EOF on an empty Read.
+	NonBlocking ConcurrencyMode = iota
+	// Blocking makes Read wait for data to arrive and Write wait for
+	// capacity to free up, turning the buffer into a pipe between
+	// producer and consumer goroutines.
+	Blocking
+)
+
+// concurrentBuffer guards inner with a single mutex; in Blocking mode,
+// notEmpty/notFull park callers until the buffer is no longer empty/full.
+// Reset must not be called concurrently with an in-flight blocked Read or
+// Write: it rewinds inner while they may be mid-retry against it.
+type concurrentBuffer struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	inner    Buffer
+	mode     ConcurrencyMode
+	closed   bool
+	capacity int64 // Blocking-mode cap on in-flight bytes; see NewConcurrent.
+	size     int64 // bytes written to inner but not yet read, per this wrapper
+}
+
+// NewConcurrent makes inner safe to Read and Write from multiple goroutines
+// at once. Close unblocks any waiters: further Reads drain whatever is left
+// then return io.EOF, and further Writes return io.ErrClosedPipe.
+//
+// Blocking mode gates Write on inner.Cap(), so it only provides real
+// backpressure when that's a true bound. Buffers that report an unbounded
+// Cap() and instead evict unread data on overflow (NewRing, for instance)
+// need NewConcurrentSized, which tracks capacity independently of inner.
+func NewConcurrent(inner Buffer, mode ConcurrencyMode) Buffer {
+	return newConcurrent(inner, mode, inner.Cap())
+}
+
+// NewConcurrentSized is NewConcurrent for inner buffers whose Cap() isn't a
+// true bound — e.g. NewRing, which reports an unbounded Cap() and silently
+// evicts unread bytes on overflow instead of blocking or erroring. capacity
+// is tracked by the wrapper itself rather than read back from inner.Cap(),
+// so Blocking-mode Write correctly waits for room instead of overrunning
+// inner's real, physical capacity. It has no effect in NonBlocking mode,
+// which defers fullness handling to inner as NewConcurrent already does.
+func NewConcurrentSized(inner Buffer, mode ConcurrencyMode, capacity int64) Buffer {
+	return newConcurrent(inner, mode, capacity)
+}
+
+func newConcurrent(inner Buffer, mode ConcurrencyMode, capacity int64) Buffer {
+	c := &concurrentBuffer{inner: inner, mode: mode, capacity: capacity}
+	c.notEmpty = sync.NewCond(&c.mu)
+	c.notFull = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *concurrentBuffer) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.mode == NonBlocking {
+		n, err := c.inner.Read(p)
+		c.notFull.Broadcast()
+		return n, err
+	}
+
+	for c.inner.Len() == 0 && !c.closed {
+		c.notEmpty.Wait()
+	}
+	n, err := c.inner.Read(p)
+	c.size -= int64(n)
+	// Broadcast, not Signal: the capacity this Read just freed may be enough
+	// for more than one parked Writer to make progress.
+	c.notFull.Broadcast()
+	if n == 0 && err == io.EOF && c.closed {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func (c *concurrentBuffer) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	if c.mode == NonBlocking {
+		n, err := c.inner.Write(p)
+		c.notEmpty.Broadcast()
+		return n, err
+	}
+
+	var total int
+	for len(p) > 0 {
+		for c.size >= c.capacity && !c.closed {
+			c.notFull.Wait()
+		}
+		if c.closed {
+			return total, io.ErrClosedPipe
+		}
+
+		// Never hand inner more than it has room for under our own
+		// accounting, even if inner itself wouldn't refuse the extra bytes
+		// (e.g. a ring that evicts unread data instead of erroring).
+		chunk := p
+		if avail := c.capacity - c.size; int64(len(chunk)) > avail {
+			chunk = chunk[:avail]
+		}
+
+		n, err := c.inner.Write(chunk)
+		c.size += int64(n)
+		total += n
+		p = p[n:]
+		// Broadcast, not Signal: the data this Write just added may be
+		// enough for more than one parked Reader to make progress.
+		c.notEmpty.Broadcast()
+		if err != nil && err != io.ErrShortWrite {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (c *concurrentBuffer) Len() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inner.Len()
+}
+
+func (c *concurrentBuffer) Cap() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mode == Blocking {
+		return c.capacity
+	}
+	return c.inner.Cap()
+}
+
+func (c *concurrentBuffer) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inner.Reset()
+	c.size = 0
+	c.notEmpty.Broadcast()
+	c.notFull.Broadcast()
+}
+
+// Close unblocks all waiters. After Close, Reads drain whatever data is left
+// and then return io.EOF, and Writes return io.ErrClosedPipe.
+func (c *concurrentBuffer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.notEmpty.Broadcast()
+	c.notFull.Broadcast()
+	return nil
+}
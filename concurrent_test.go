@@ -0,0 +1,125 @@
+package buffer
+
+import (
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentNonBlockingShortWrite(t *testing.T) {
+	buf := NewConcurrent(New(5), NonBlocking)
+	n, err := buf.Write([]byte("hello world"))
+	if err != io.ErrShortWrite {
+		t.Errorf("expected io.ErrShortWrite, got %v", err)
+	}
+	if n != 5 {
+		t.Errorf("expected 5 bytes written, got %d", n)
+	}
+}
+
+func TestConcurrentClose(t *testing.T) {
+	buf := NewConcurrent(New(16), Blocking)
+	buf.Write([]byte("hi"))
+	buf.(io.Closer).Close()
+
+	data := make([]byte, 2)
+	n, err := buf.Read(data)
+	if n != 2 || err != nil {
+		t.Errorf("expected to drain remaining data, got n=%d err=%v", n, err)
+	}
+	if _, err := buf.Read(data); err != io.EOF {
+		t.Errorf("expected io.EOF once drained, got %v", err)
+	}
+	if _, err := buf.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Errorf("expected io.ErrClosedPipe on write after close, got %v", err)
+	}
+}
+
+// TestConcurrentStress pushes 100MB through a blocking NewConcurrentSized-
+// wrapped ring buffer with several producers and several consumers running
+// at once.
+// Each producer writes nothing but its own distinct byte value, so beyond
+// checking the total byte count, the test also tallies how many bytes of
+// each value were actually read: corruption that drops or overwrites one
+// producer's unread bytes (as a buffer that silently evicts on overflow
+// would do) shows up as a short count for that value even when the overall
+// total happens to match. Running multiple consumers exercises the case
+// where a single Write can free up enough data for more than one parked
+// Reader.
+func TestConcurrentStress(t *testing.T) {
+	const (
+		producers   = 4
+		consumers   = 3
+		perProducer = 25 * 1024 * 1024
+		ringPage    = 4096
+	)
+
+	buf := NewConcurrentSized(NewRing(New(ringPage)), Blocking, ringPage)
+
+	var producerWG sync.WaitGroup
+	producerWG.Add(producers)
+	for i := 0; i < producers; i++ {
+		go func(tag byte) {
+			defer producerWG.Done()
+			block := make([]byte, 32*1024)
+			for i := range block {
+				block[i] = tag
+			}
+			written := 0
+			for written < perProducer {
+				n := len(block)
+				if remaining := perProducer - written; n > remaining {
+					n = remaining
+				}
+				w, _ := buf.Write(block[:n])
+				written += w
+			}
+		}(byte(100 + i))
+	}
+
+	var mu sync.Mutex
+	var counts [256]int64
+	var total int64
+	var consumerWG sync.WaitGroup
+	consumerWG.Add(consumers)
+	for i := 0; i < consumers; i++ {
+		go func() {
+			defer consumerWG.Done()
+			var local [256]int64
+			chunk := make([]byte, 4096)
+			for {
+				n, err := buf.Read(chunk)
+				for _, b := range chunk[:n] {
+					local[b]++
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Errorf("unexpected read error: %v", err)
+					break
+				}
+			}
+			mu.Lock()
+			for b, n := range local {
+				counts[b] += n
+				total += n
+			}
+			mu.Unlock()
+		}()
+	}
+
+	producerWG.Wait()
+	buf.(io.Closer).Close()
+	consumerWG.Wait()
+
+	if want := int64(producers * perProducer); total != want {
+		t.Errorf("expected %d consumers to read %d bytes total, got %d", consumers, want, total)
+	}
+	for i := 0; i < producers; i++ {
+		tag := byte(100 + i)
+		if counts[tag] != perProducer {
+			t.Errorf("producer tag %d: expected %d bytes read, got %d", tag, perProducer, counts[tag])
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package buffer
+
+import "io"
+
+// page holds a single cached, possibly partially-dirty page of an overlay
+// buffer.
+type page struct {
+	data  []byte
+	dirty []bool
+}
+
+// Overlayer is implemented by buffers returned from NewOverlay, exposing
+// control over the copy-on-write page cache sitting in front of the parent.
+type Overlayer interface {
+	// Commit writes back only the dirty ranges to the parent and clears the
+	// dirty bits.
+	Commit() error
+	// Discard drops all cached pages without flushing them to the parent.
+	Discard()
+}
+
+type overlayBuffer struct {
+	parent   BufferAt
+	pageSize int64
+	pages    map[int64]*page
+	size     int64
+	roff     int64
+}
+
+// NewOverlay returns a paged copy-on-write view on top of parent: ReadAt and
+// WriteAt fault pages in from parent lazily and cache them locally, so that
+// random WriteAt traffic can be batched into a single Commit instead of
+// hitting the parent on every call.
+func NewOverlay(parent BufferAt, pageSize int64) BufferAt {
+	return &overlayBuffer{
+		parent:   parent,
+		pageSize: pageSize,
+		pages:    make(map[int64]*page),
+		size:     parent.Len(),
+	}
+}
+
+func (o *overlayBuffer) getPage(pgI int64) (*page, error) {
+	if pg, ok := o.pages[pgI]; ok {
+		return pg, nil
+	}
+	pg := &page{data: make([]byte, o.pageSize), dirty: make([]bool, o.pageSize)}
+	if _, err := o.parent.ReadAt(pg.data, pgI*o.pageSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+	o.pages[pgI] = pg
+	return pg, nil
+}
+
+func (o *overlayBuffer) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		cur := off + int64(n)
+		if cur >= o.size {
+			return n, io.EOF
+		}
+		pgI := cur / o.pageSize
+		pgO := cur % o.pageSize
+		pg, err := o.getPage(pgI)
+		if err != nil {
+			return n, err
+		}
+		want := int64(len(p) - n)
+		if avail := o.pageSize - pgO; want > avail {
+			want = avail
+		}
+		if remaining := o.size - cur; want > remaining {
+			want = remaining
+		}
+		copy(p[n:int64(n)+want], pg.data[pgO:pgO+want])
+		n += int(want)
+	}
+	return n, nil
+}
+
+func (o *overlayBuffer) WriteAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		cur := off + int64(n)
+		pgI := cur / o.pageSize
+		pgO := cur % o.pageSize
+		pg, err := o.getPage(pgI)
+		if err != nil {
+			return n, err
+		}
+		want := int64(len(p) - n)
+		if avail := o.pageSize - pgO; want > avail {
+			want = avail
+		}
+		copy(pg.data[pgO:pgO+want], p[n:int64(n)+want])
+		for i := pgO; i < pgO+want; i++ {
+			pg.dirty[i] = true
+		}
+		n += int(want)
+	}
+	if end := off + int64(len(p)); end > o.size {
+		o.size = end
+	}
+	return n, nil
+}
+
+func (o *overlayBuffer) Read(p []byte) (int, error) {
+	n, err := o.ReadAt(p, o.roff)
+	o.roff += int64(n)
+	return n, err
+}
+
+func (o *overlayBuffer) Write(p []byte) (int, error) {
+	return o.WriteAt(p, o.size)
+}
+
+func (o *overlayBuffer) Len() int64 { return o.size }
+
+func (o *overlayBuffer) Cap() int64 { return o.parent.Cap() }
+
+func (o *overlayBuffer) Reset() {
+	o.pages = make(map[int64]*page)
+	o.size = 0
+	o.roff = 0
+}
+
+func (o *overlayBuffer) Commit() error {
+	for pgI, pg := range o.pages {
+		start := -1
+		for i := 0; i <= len(pg.dirty); i++ {
+			isDirty := i < len(pg.dirty) && pg.dirty[i]
+			if isDirty && start < 0 {
+				start = i
+			} else if !isDirty && start >= 0 {
+				runOff := pgI*o.pageSize + int64(start)
+				if _, err := o.parent.WriteAt(pg.data[start:i], runOff); err != nil {
+					return err
+				}
+				start = -1
+			}
+		}
+		for i := range pg.dirty {
+			pg.dirty[i] = false
+		}
+	}
+	return nil
+}
+
+func (o *overlayBuffer) Discard() {
+	o.pages = make(map[int64]*page)
+}
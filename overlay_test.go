@@ -0,0 +1,112 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOverlayCommit(t *testing.T) {
+	writes := []struct {
+		off  int64
+		data string
+	}{
+		{40, "hello"},
+		{5, "world"},
+		{20, "xyz"},
+		{0, "ab"},
+	}
+
+	// New()'s WriteAt rejects any offset beyond its current Len() (no gaps),
+	// so a scattered-offset test needs a gap-tolerant backing buffer like
+	// NewFile instead.
+	directFile, err := ioutil.TempFile("", "buffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(directFile.Name())
+	defer directFile.Close()
+	direct := NewFile(64, directFile)
+
+	for _, w := range writes {
+		if _, err := direct.WriteAt([]byte(w.data), w.off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := make([]byte, direct.Len())
+	direct.ReadAt(want, 0)
+
+	parentFile, err := ioutil.TempFile("", "buffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(parentFile.Name())
+	defer parentFile.Close()
+	parent := NewFile(64, parentFile)
+
+	overlay := NewOverlay(parent, 16)
+	for _, w := range writes {
+		if _, err := overlay.WriteAt([]byte(w.data), w.off); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := overlay.(Overlayer).Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]byte, parent.Len())
+	parent.ReadAt(got, 0)
+	if !bytes.Equal(got, want) {
+		t.Errorf("committed overlay doesn't match direct writes:\n got  %q\n want %q", got, want)
+	}
+}
+
+func TestOverlayDiscard(t *testing.T) {
+	parent := New(256)
+	parent.WriteAt([]byte("hello world"), 0)
+
+	overlay := NewOverlay(parent, 16)
+	overlay.WriteAt([]byte("XXXXX"), 0)
+	overlay.(Overlayer).Discard()
+
+	got := make([]byte, 5)
+	overlay.ReadAt(got, 0)
+	if string(got) != "hello" {
+		t.Errorf("expected discarded overlay to read through to parent, got %q", got)
+	}
+}
+
+func TestOverlayEOFZeroFill(t *testing.T) {
+	parent := New(256)
+	parent.WriteAt([]byte("ab"), 0)
+
+	overlay := NewOverlay(parent, 16)
+	overlay.WriteAt([]byte("Z"), 10)
+
+	got := make([]byte, 16)
+	n, err := overlay.ReadAt(got, 0)
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF for a short ReadAt, got %v", err)
+	}
+	want := append([]byte("ab"), append(make([]byte, 8), 'Z')...)
+	if !bytes.Equal(got[:n], want) {
+		t.Errorf("expected zero-filled gap, got %q want %q", got[:n], want)
+	}
+}
+
+func TestOverlayReset(t *testing.T) {
+	parent := New(256)
+	overlay := NewOverlay(parent, 16)
+	overlay.WriteAt([]byte("hello"), 0)
+	overlay.Reset()
+
+	if overlay.Len() != 0 {
+		t.Errorf("expected overlay to be empty after reset, got len %d", overlay.Len())
+	}
+	if parent.Len() != 0 {
+		t.Errorf("reset should not touch the parent")
+	}
+}
@@ -0,0 +1,275 @@
+package buffer
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrInvalidSnapshot is returned by Rollback and Release for a SnapshotID
+// that is unknown, already released, or was invalidated by a Reset.
+var ErrInvalidSnapshot = errors.New("buffer: invalid snapshot id")
+
+// defaultSnapshotPageSize is the page size NewSnapshotted uses for its
+// copy-on-write cache.
+const defaultSnapshotPageSize = 4096
+
+// SnapshotID identifies a point-in-time snapshot taken by a Snapshotter.
+type SnapshotID uint64
+
+// Snapshotter is implemented by BufferAt values that support checkpoint and
+// rollback, such as the wrapper returned by NewSnapshotted.
+type Snapshotter interface {
+	// Snapshot freezes the current contents and returns an id that Rollback
+	// or Release can later refer to.
+	Snapshot() (SnapshotID, error)
+	// Rollback restores the contents and read cursor to the state captured
+	// by Snapshot(id).
+	Rollback(id SnapshotID) error
+	// Release forgets a snapshot, allowing pages only it still references
+	// to be reclaimed.
+	Release(id SnapshotID) error
+}
+
+// snapPage is one page of a snapshottedBuffer, tagged with the generation in
+// which this particular version of the page was written.
+type snapPage struct {
+	data []byte
+	gen  int64
+}
+
+// snapshotState is the frozen state captured by Snapshot.
+type snapshotState struct {
+	pages map[int64]*snapPage
+	size  int64
+	roff  int64
+}
+
+// snapshottedBuffer is a paged copy-on-write BufferAt: writes after a
+// Snapshot clone the pages they touch into the current generation rather
+// than mutating a page a live snapshot still points to.
+type snapshottedBuffer struct {
+	parent   BufferAt
+	pageSize int64
+	pages    map[int64]*snapPage
+	size     int64
+	roff     int64
+
+	gen       int64
+	nextID    SnapshotID
+	snapshots map[SnapshotID]*snapshotState
+
+	// refs counts, per page index and generation, how many of {head,
+	// live snapshots} still reference that page version. A (pageIndex,
+	// gen) entry is removed once nothing references it any more, freeing
+	// it for the garbage collector.
+	refs map[int64]map[int64]int
+}
+
+// NewSnapshotted wraps inner with Snapshot/Rollback/Release support, via the
+// Snapshotter interface.
+func NewSnapshotted(inner BufferAt) BufferAt {
+	return &snapshottedBuffer{
+		parent:    inner,
+		pageSize:  defaultSnapshotPageSize,
+		pages:     make(map[int64]*snapPage),
+		snapshots: make(map[SnapshotID]*snapshotState),
+		refs:      make(map[int64]map[int64]int),
+	}
+}
+
+func (b *snapshottedBuffer) incRef(pgI, gen int64) {
+	m, ok := b.refs[pgI]
+	if !ok {
+		m = make(map[int64]int)
+		b.refs[pgI] = m
+	}
+	m[gen]++
+}
+
+func (b *snapshottedBuffer) decRef(pgI, gen int64) {
+	m, ok := b.refs[pgI]
+	if !ok {
+		return
+	}
+	m[gen]--
+	if m[gen] <= 0 {
+		delete(m, gen)
+		if len(m) == 0 {
+			delete(b.refs, pgI)
+		}
+	}
+}
+
+// refPages increments the reference count of every page in m (head or a
+// snapshot acquiring them).
+func (b *snapshottedBuffer) refPages(m map[int64]*snapPage) {
+	for pgI, pg := range m {
+		b.incRef(pgI, pg.gen)
+	}
+}
+
+// unrefPages decrements the reference count of every page in m (head or a
+// snapshot releasing them).
+func (b *snapshottedBuffer) unrefPages(m map[int64]*snapPage) {
+	for pgI, pg := range m {
+		b.decRef(pgI, pg.gen)
+	}
+}
+
+func copySnapPages(m map[int64]*snapPage) map[int64]*snapPage {
+	out := make(map[int64]*snapPage, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func (b *snapshottedBuffer) getPage(pgI int64) (*snapPage, error) {
+	if pg, ok := b.pages[pgI]; ok {
+		return pg, nil
+	}
+	data := make([]byte, b.pageSize)
+	if _, err := b.parent.ReadAt(data, pgI*b.pageSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+	pg := &snapPage{data: data, gen: b.gen}
+	b.pages[pgI] = pg
+	b.incRef(pgI, pg.gen)
+	return pg, nil
+}
+
+// getPageForWrite returns a page safe to mutate in place for the current
+// generation, cloning it first if the cached version was written in an
+// earlier generation, i.e. before the latest Snapshot or Rollback (even if
+// that snapshot has since been released). Cloning moves head's reference
+// from the old generation to the new one.
+func (b *snapshottedBuffer) getPageForWrite(pgI int64) (*snapPage, error) {
+	old, ok := b.pages[pgI]
+	if !ok {
+		return b.getPage(pgI)
+	}
+	if old.gen == b.gen {
+		return old, nil
+	}
+	data := make([]byte, b.pageSize)
+	copy(data, old.data)
+	pg := &snapPage{data: data, gen: b.gen}
+	b.pages[pgI] = pg
+	b.decRef(pgI, old.gen)
+	b.incRef(pgI, pg.gen)
+	return pg, nil
+}
+
+func (b *snapshottedBuffer) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		cur := off + int64(n)
+		if cur >= b.size {
+			return n, io.EOF
+		}
+		pgI := cur / b.pageSize
+		pgO := cur % b.pageSize
+		pg, err := b.getPage(pgI)
+		if err != nil {
+			return n, err
+		}
+		want := int64(len(p) - n)
+		if avail := b.pageSize - pgO; want > avail {
+			want = avail
+		}
+		if remaining := b.size - cur; want > remaining {
+			want = remaining
+		}
+		copy(p[n:int64(n)+want], pg.data[pgO:pgO+want])
+		n += int(want)
+	}
+	return n, nil
+}
+
+func (b *snapshottedBuffer) WriteAt(p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		cur := off + int64(n)
+		pgI := cur / b.pageSize
+		pgO := cur % b.pageSize
+		pg, err := b.getPageForWrite(pgI)
+		if err != nil {
+			return n, err
+		}
+		want := int64(len(p) - n)
+		if avail := b.pageSize - pgO; want > avail {
+			want = avail
+		}
+		copy(pg.data[pgO:pgO+want], p[n:int64(n)+want])
+		n += int(want)
+	}
+	if end := off + int64(len(p)); end > b.size {
+		b.size = end
+	}
+	return n, nil
+}
+
+func (b *snapshottedBuffer) Read(p []byte) (int, error) {
+	n, err := b.ReadAt(p, b.roff)
+	b.roff += int64(n)
+	return n, err
+}
+
+func (b *snapshottedBuffer) Write(p []byte) (int, error) {
+	return b.WriteAt(p, b.size)
+}
+
+func (b *snapshottedBuffer) Len() int64 { return b.size }
+
+func (b *snapshottedBuffer) Cap() int64 { return b.parent.Cap() }
+
+func (b *snapshottedBuffer) Reset() {
+	b.pages = make(map[int64]*snapPage)
+	b.size = 0
+	b.roff = 0
+	b.gen++
+	b.snapshots = make(map[SnapshotID]*snapshotState)
+	b.refs = make(map[int64]map[int64]int)
+}
+
+func (b *snapshottedBuffer) Snapshot() (SnapshotID, error) {
+	id := b.nextID
+	b.nextID++
+	pages := copySnapPages(b.pages)
+	b.snapshots[id] = &snapshotState{
+		pages: pages,
+		size:  b.size,
+		roff:  b.roff,
+	}
+	// The snapshot now shares every current page with head.
+	b.refPages(pages)
+	b.gen++
+	return id, nil
+}
+
+func (b *snapshottedBuffer) Rollback(id SnapshotID) error {
+	state, ok := b.snapshots[id]
+	if !ok {
+		return ErrInvalidSnapshot
+	}
+	b.unrefPages(b.pages)
+	b.pages = copySnapPages(state.pages)
+	b.refPages(b.pages)
+	b.size = state.size
+	b.roff = state.roff
+	b.gen++
+	return nil
+}
+
+// Release forgets a snapshot. Pages whose only remaining reference was this
+// snapshot are unreferenced and reclaimed; pages still shared with head or
+// another live snapshot are left alone.
+func (b *snapshottedBuffer) Release(id SnapshotID) error {
+	state, ok := b.snapshots[id]
+	if !ok {
+		return ErrInvalidSnapshot
+	}
+	b.unrefPages(state.pages)
+	delete(b.snapshots, id)
+	return nil
+}
@@ -0,0 +1,133 @@
+package buffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSnapshotRollback(t *testing.T) {
+	buf := NewSnapshotted(New(1024))
+	buf.WriteAt([]byte("hello"), 0)
+
+	snap, err := buf.(Snapshotter).Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf.WriteAt([]byte("XXXXX"), 0)
+	got := make([]byte, 5)
+	buf.ReadAt(got, 0)
+	if string(got) != "XXXXX" {
+		t.Fatalf("expected write to be visible before rollback, got %q", got)
+	}
+
+	if err := buf.(Snapshotter).Rollback(snap); err != nil {
+		t.Fatal(err)
+	}
+	buf.ReadAt(got, 0)
+	if string(got) != "hello" {
+		t.Errorf("expected rollback to restore prior contents, got %q", got)
+	}
+}
+
+func TestSnapshotNested(t *testing.T) {
+	buf := NewSnapshotted(New(1024))
+	buf.WriteAt([]byte("aaaa"), 0)
+
+	snap1, _ := buf.(Snapshotter).Snapshot()
+	buf.WriteAt([]byte("bbbb"), 0)
+
+	snap2, _ := buf.(Snapshotter).Snapshot()
+	buf.WriteAt([]byte("cccc"), 0)
+
+	got := make([]byte, 4)
+	buf.ReadAt(got, 0)
+	if string(got) != "cccc" {
+		t.Fatalf("expected latest write, got %q", got)
+	}
+
+	if err := buf.(Snapshotter).Rollback(snap2); err != nil {
+		t.Fatal(err)
+	}
+	buf.ReadAt(got, 0)
+	if string(got) != "bbbb" {
+		t.Errorf("expected rollback to snap2 to restore %q, got %q", "bbbb", got)
+	}
+
+	if err := buf.(Snapshotter).Rollback(snap1); err != nil {
+		t.Fatal(err)
+	}
+	buf.ReadAt(got, 0)
+	if string(got) != "aaaa" {
+		t.Errorf("expected rollback to snap1 to restore %q, got %q", "aaaa", got)
+	}
+}
+
+func TestSnapshotRelease(t *testing.T) {
+	buf := NewSnapshotted(New(1024))
+	buf.WriteAt([]byte("hello"), 0)
+
+	snap, _ := buf.(Snapshotter).Snapshot()
+	if err := buf.(Snapshotter).Release(snap); err != nil {
+		t.Fatal(err)
+	}
+	if err := buf.(Snapshotter).Rollback(snap); err != ErrInvalidSnapshot {
+		t.Errorf("expected ErrInvalidSnapshot after release, got %v", err)
+	}
+}
+
+func TestSnapshotResetInvalidates(t *testing.T) {
+	buf := NewSnapshotted(New(1024))
+	buf.WriteAt([]byte("hello"), 0)
+
+	snap, _ := buf.(Snapshotter).Snapshot()
+	buf.Reset()
+
+	if err := buf.(Snapshotter).Rollback(snap); err != ErrInvalidSnapshot {
+		t.Errorf("expected ErrInvalidSnapshot after reset, got %v", err)
+	}
+}
+
+func TestSnapshotPageRefcounting(t *testing.T) {
+	buf := NewSnapshotted(New(1024)).(*snapshottedBuffer)
+	buf.WriteAt([]byte("hello"), 0)
+
+	snap, _ := buf.Snapshot()
+	if got := buf.refs[0][buf.pages[0].gen]; got != 2 {
+		t.Fatalf("expected page 0 to be shared by head and the snapshot (refcount 2), got %d", got)
+	}
+
+	// A write after the snapshot clones the page into a new generation;
+	// head's reference moves off the snapshotted version, which the
+	// snapshot alone still holds.
+	buf.WriteAt([]byte("XXXXX"), 0)
+	snappedGen := buf.snapshots[snap].pages[0].gen
+	if got := buf.refs[0][snappedGen]; got != 1 {
+		t.Errorf("expected the pre-write version to be referenced only by the snapshot, got refcount %d", got)
+	}
+
+	if err := buf.Release(snap); err != nil {
+		t.Fatal(err)
+	}
+	if _, stillTracked := buf.refs[0][snappedGen]; stillTracked {
+		t.Errorf("expected releasing the only remaining reference to free the page version")
+	}
+}
+
+func TestSnapshotReadCursor(t *testing.T) {
+	buf := NewSnapshotted(New(1024))
+	buf.Write([]byte("hello world"))
+
+	snap, _ := buf.(Snapshotter).Snapshot()
+	data := make([]byte, 5)
+	buf.Read(data)
+	if !bytes.Equal(data, []byte("hello")) {
+		t.Fatalf("unexpected read before rollback: %q", data)
+	}
+
+	buf.(Snapshotter).Rollback(snap)
+	buf.Read(data)
+	if !bytes.Equal(data, []byte("hello")) {
+		t.Errorf("expected rollback to reset the read cursor, got %q", data)
+	}
+}